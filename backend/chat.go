@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func reactionsKey(boardID int, msgID string) string {
+	return fmt.Sprintf("board:%d:chat:%s:reactions", boardID, msgID)
+}
+
+func reactorsKey(boardID int, msgID, emoji string) string {
+	return fmt.Sprintf("board:%d:chat:%s:reactors:%s", boardID, msgID, emoji)
+}
+
+// react records a user's reaction to a message, enforcing one-per-user via
+// the reactors set, then persists and broadcasts the updated counts.
+func react(c *client, boardID int, messageID, emoji string) {
+	added, _ := rdb.SAdd(ctx, reactorsKey(boardID, messageID, emoji), c.name).Result()
+	if added == 0 {
+		return // already reacted with this emoji
+	}
+	rdb.HIncrBy(ctx, reactionsKey(boardID, messageID), emoji, 1)
+
+	writeToDisk(marshalChatEvent("react", messageID, emoji, 1))
+	publishReactionUpdate(boardID, messageID)
+}
+
+func unreact(c *client, boardID int, messageID, emoji string) {
+	removed, _ := rdb.SRem(ctx, reactorsKey(boardID, messageID, emoji), c.name).Result()
+	if removed == 0 {
+		return // hadn't reacted
+	}
+	n, _ := rdb.HIncrBy(ctx, reactionsKey(boardID, messageID), emoji, -1).Result()
+	if n <= 0 {
+		// Drop the field instead of leaving a "0" count lingering, so the
+		// live broadcast agrees with the cold-load path, which already
+		// filters reactions down to n>0.
+		rdb.HDel(ctx, reactionsKey(boardID, messageID), emoji)
+	}
+
+	writeToDisk(marshalChatEvent("react", messageID, emoji, -1))
+	publishReactionUpdate(boardID, messageID)
+}
+
+func marshalChatEvent(eventType, messageID, emoji string, delta int) string {
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":      eventType,
+		"messageId": messageID,
+		"emoji":     emoji,
+		"delta":     delta,
+	})
+	return string(b)
+}
+
+func publishReactionUpdate(boardID int, messageID string) {
+	counts, _ := rdb.HGetAll(ctx, reactionsKey(boardID, messageID)).Result()
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":      "reaction_update",
+		"messageId": messageID,
+		"reactions": counts,
+	})
+	rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), b)
+}
+
+// deleteMessage purges a chat message's reaction keys and publishes a
+// reaction_purge frame for it. The message itself stays in the chat history.
+func deleteMessage(boardID int, messageID string) {
+	counts, _ := rdb.HGetAll(ctx, reactionsKey(boardID, messageID)).Result()
+	for emoji := range counts {
+		rdb.Del(ctx, reactorsKey(boardID, messageID, emoji))
+	}
+	rdb.Del(ctx, reactionsKey(boardID, messageID))
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":      "reaction_purge",
+		"messageId": messageID,
+	})
+	rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), b)
+}
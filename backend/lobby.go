@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxSpectators = 20
+	roomIdleTTL          = 10 * time.Minute
+	reapInterval         = 30 * time.Second
+)
+
+// RoomInfo is the shape returned to clients in a list_rooms response.
+type RoomInfo struct {
+	BoardID    int    `json:"boardId"`
+	RoomCode   string `json:"roomCode"`
+	Name       string `json:"name"`
+	Players    int    `json:"players"`
+	Spectators int    `json:"spectators"`
+	Status     string `json:"status"`
+	Visibility string `json:"visibility"`
+}
+
+func metaKey(boardID int) string { return fmt.Sprintf("board:%d:meta", boardID) }
+
+func nextBoardID() (int, error) {
+	id, err := rdb.Incr(ctx, "rooms:next_id").Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// createRoom allocates a fresh board, records its metadata, and registers it
+// in rooms:active so list_rooms can report it (private rooms are not listed).
+func createRoom(c *client, msg Message) {
+	boardID, err := nextBoardID()
+	if err != nil {
+		sendJSON(c, map[string]string{"type": "error", "error": "failed to create room"})
+		return
+	}
+
+	name := msg.RoomName
+	if name == "" {
+		name = fmt.Sprintf("Room %d", boardID)
+	}
+	visibility := "public"
+	if msg.Password != "" {
+		visibility = "private"
+	}
+	maxSpectators := msg.MaxSpectators
+	if maxSpectators <= 0 {
+		maxSpectators = defaultMaxSpectators
+	}
+
+	resetBoardState(boardID)
+	rdb.HSet(ctx, metaKey(boardID),
+		"name", name,
+		"owner", c.name,
+		"created_at", time.Now().UTC().Format(time.RFC3339),
+		"visibility", visibility,
+		"maxSpectators", maxSpectators,
+		"password", msg.Password,
+	)
+	rdb.SAdd(ctx, "rooms:active", boardID)
+	roomCode := strconv.Itoa(boardID)
+	rdb.HSet(ctx, "rooms:codes", roomCode, boardID)
+
+	sendJSON(c, map[string]interface{}{
+		"type":     "room_created",
+		"boardId":  boardID,
+		"roomCode": roomCode,
+	})
+}
+
+// listRooms reports every public room along with live player/spectator
+// counts so a client can render a lobby screen.
+func listRooms(c *client) {
+	ids, err := rdb.SMembers(ctx, "rooms:active").Result()
+	if err != nil {
+		sendJSON(c, map[string]string{"type": "error", "error": "failed to list rooms"})
+		return
+	}
+
+	rooms := make([]RoomInfo, 0, len(ids))
+	for _, idStr := range ids {
+		boardID, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		meta, _ := rdb.HGetAll(ctx, metaKey(boardID)).Result()
+		if meta["visibility"] == "private" {
+			continue
+		}
+		board, _ := rdb.HGetAll(ctx, fmt.Sprintf("board:%d", boardID)).Result()
+
+		players := 0
+		for _, p := range []string{board["playerXName"], board["playerOName"]} {
+			if p != "" && p != "Waiting..." {
+				players++
+			}
+		}
+		specCount, _ := rdb.LLen(ctx, fmt.Sprintf("board:%d:queue", boardID)).Result()
+
+		status := "waiting"
+		if players == 2 {
+			status = "in_progress"
+		}
+		if board["winner"] != "" {
+			status = "finished"
+		}
+
+		rooms = append(rooms, RoomInfo{
+			BoardID:    boardID,
+			RoomCode:   idStr,
+			Name:       meta["name"],
+			Players:    players,
+			Spectators: int(specCount),
+			Status:     status,
+			Visibility: meta["visibility"],
+		})
+	}
+
+	sendJSON(c, map[string]interface{}{"type": "rooms_list", "rooms": rooms})
+}
+
+// resolveBoardID figures out which board a join targets: an explicit
+// boardId, a room code, or the default lobby board (0) if neither is set.
+func resolveBoardID(msg Message) int {
+	if msg.BoardID != 0 {
+		return msg.BoardID
+	}
+	if msg.RoomCode != "" {
+		if idStr, err := rdb.HGet(ctx, "rooms:codes", msg.RoomCode).Result(); err == nil {
+			if id, err := strconv.Atoi(idStr); err == nil {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// startLobbyReaper launches the background scan that deletes rooms left
+// empty for longer than roomIdleTTL.
+func startLobbyReaper() {
+	ticker := time.NewTicker(reapInterval)
+	go func() {
+		for range ticker.C {
+			reapEmptyRooms()
+		}
+	}()
+}
+
+func reapEmptyRooms() {
+	ids, err := rdb.SMembers(ctx, "rooms:active").Result()
+	if err != nil {
+		return
+	}
+	for _, idStr := range ids {
+		boardID, err := strconv.Atoi(idStr)
+		if err != nil || boardID == 0 {
+			continue // board 0 is the permanent default lobby
+		}
+
+		boardKey := fmt.Sprintf("board:%d", boardID)
+		queueKey := fmt.Sprintf("board:%d:queue", boardID)
+		meta := metaKey(boardID)
+
+		data, _ := rdb.HGetAll(ctx, boardKey).Result()
+		playersEmpty := (data["playerXName"] == "" || data["playerXName"] == "Waiting...") &&
+			(data["playerOName"] == "" || data["playerOName"] == "Waiting...")
+		specLen, _ := rdb.LLen(ctx, queueKey).Result()
+
+		if !playersEmpty || specLen > 0 {
+			rdb.HDel(ctx, meta, "empty_since")
+			continue
+		}
+
+		emptySince, err := rdb.HGet(ctx, meta, "empty_since").Result()
+		if err != nil {
+			rdb.HSet(ctx, meta, "empty_since", time.Now().UTC().Format(time.RFC3339))
+			continue
+		}
+		since, err := time.Parse(time.RFC3339, emptySince)
+		if err != nil || time.Since(since) < roomIdleTTL {
+			continue
+		}
+
+		log.Printf("reaping idle room %d", boardID)
+		rdb.Del(ctx, boardKey, queueKey, meta)
+		rdb.SRem(ctx, "rooms:active", boardID)
+		rdb.HDel(ctx, "rooms:codes", idStr)
+	}
+}
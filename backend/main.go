@@ -4,23 +4,26 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/redis/go-redis/v9"
 )
 
 var (
 	ctx      = context.Background()
-	rdb      *redis.Client
+	rdb      *store
 	upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
 	// Mutex for the File Database to prevent concurrent write errors
 	fileMu sync.Mutex
+
+	cacheTTLFlag = flag.Duration("cache-ttl", 5*time.Second, "client-side cache TTL for hot board/spectator reads")
 )
 
 // --- Lua Script for Game Logic ---
@@ -106,30 +109,49 @@ else
   end
 end
 
-redis.call('HSET', board, 'cells', join(cellTbl), 'turn', turn, 'winner', winner)
-return { status, join(cellTbl), winner, turn }
+local turnTimeoutSecs = tonumber(ARGV[3]) or 30
+local deadline = ''
+if status == 'ok' then
+  local now = redis.call('TIME')
+  deadline = tostring(tonumber(now[1]) + turnTimeoutSecs)
+end
+
+redis.call('HSET', board, 'cells', join(cellTbl), 'turn', turn, 'winner', winner, 'turn_deadline', deadline)
+return { status, join(cellTbl), winner, turn, deadline }
 `
 
 type Message struct {
-	Type       string            `json:"type"`
-	BoardID    int               `json:"boardId,omitempty"`
-	Position   int               `json:"position,omitempty"`
-	Symbol     string            `json:"symbol,omitempty"`
-	Name       string            `json:"name,omitempty"`
-	Spectators []string          `json:"spectators,omitempty"`
-	Board      map[string]string `json:"board,omitempty"`
-	Content    string            `json:"content,omitempty"`
+	Type          string            `json:"type"`
+	BoardID       int               `json:"boardId,omitempty"`
+	Position      int               `json:"position,omitempty"`
+	Symbol        string            `json:"symbol,omitempty"`
+	Name          string            `json:"name,omitempty"`
+	Spectators    []string          `json:"spectators,omitempty"`
+	Board         map[string]string `json:"board,omitempty"`
+	Content       string            `json:"content,omitempty"`
+	RoomName      string            `json:"roomName,omitempty"`
+	MaxSpectators int               `json:"maxSpectators,omitempty"`
+	Password      string            `json:"password,omitempty"`
+	RoomCode      string            `json:"roomCode,omitempty"`
+	Rooms         []RoomInfo        `json:"rooms,omitempty"`
+	Token         string            `json:"token,omitempty"`
+	Expiry        int64             `json:"expiry,omitempty"`
+	Role          string            `json:"role,omitempty"`
+	MessageID     string            `json:"messageId,omitempty"`
+	Emoji         string            `json:"emoji,omitempty"`
 }
 
 type client struct {
-	conn    *websocket.Conn
-	send    chan []byte
-	mu      sync.Mutex
-	closed  bool
-	pubsub  *redis.PubSub
-	done    chan struct{}
-	name    string
-	boardID int
+	conn          *websocket.Conn
+	send          chan []byte
+	mu            sync.Mutex
+	closed        bool
+	pubsub        *pubsubConn
+	done          chan struct{}
+	name          string
+	boardID       int
+	authenticated bool
+	permissions   []string
 }
 
 // --- File Database Helpers ---
@@ -151,6 +173,9 @@ func writeToDisk(msgJSON string) {
 	}
 }
 
+// loadFromDisk replays chat_history.jsonl, folding any react records into
+// the chat message they target so a cold cache reconstructs current
+// reaction counts instead of just raw messages.
 func loadFromDisk(limit int) []string {
 	fileMu.Lock()
 	defer fileMu.Unlock()
@@ -161,10 +186,46 @@ func loadFromDisk(limit int) []string {
 	}
 	defer f.Close()
 
-	var lines []string
+	var messages []map[string]interface{}
+	reactions := map[string]map[string]int{}
+
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+		var rec map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+
+		if rec["type"] == "react" {
+			msgID, _ := rec["messageId"].(string)
+			emoji, _ := rec["emoji"].(string)
+			delta, _ := rec["delta"].(float64)
+			if reactions[msgID] == nil {
+				reactions[msgID] = map[string]int{}
+			}
+			reactions[msgID][emoji] += int(delta)
+			continue
+		}
+		messages = append(messages, rec)
+	}
+
+	lines := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if id, ok := m["id"].(string); ok {
+			if counts, ok := reactions[id]; ok {
+				clean := map[string]int{}
+				for emoji, n := range counts {
+					if n > 0 {
+						clean[emoji] = n
+					}
+				}
+				if len(clean) > 0 {
+					m["reactions"] = clean
+				}
+			}
+		}
+		b, _ := json.Marshal(m)
+		lines = append(lines, string(b))
 	}
 
 	if len(lines) > limit {
@@ -214,20 +275,27 @@ func (c *client) close() {
 
 	close(c.done)
 	if c.pubsub != nil {
-		_ = c.pubsub.Close()
+		c.pubsub.Close()
 	}
 	close(c.send)
 	_ = c.conn.Close()
 }
 
 func main() {
+	flag.Parse()
+	cacheTTL = *cacheTTLFlag
+
 	// Support Docker (REDIS_ADDR) or Localhost
 	redisAddr := os.Getenv("REDIS_ADDR")
 	if redisAddr == "" {
 		redisAddr = "localhost:6379"
 	}
 
-	rdb = redis.NewClient(&redis.Options{Addr: redisAddr})
+	var err error
+	rdb, err = newStore(redisAddr)
+	if err != nil {
+		log.Fatal("Redis connection failed:", err)
+	}
 	if err := rdb.Ping(ctx).Err(); err != nil {
 		log.Fatal("Redis connection failed:", err)
 	}
@@ -237,16 +305,25 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to load Lua script:", err)
 	}
+	transitionSha, err = rdb.ScriptLoad(ctx, transitionScript).Result()
+	if err != nil {
+		log.Fatal("Failed to load state transition script:", err)
+	}
 
-	// Init board
-	for i := 0; i < 1; i++ {
-		boardKey := fmt.Sprintf("board:%d", i)
-		exists, _ := rdb.Exists(ctx, boardKey).Result()
-		if exists == 0 {
-			resetBoardState(i)
-		}
-		rdb.Del(ctx, fmt.Sprintf("board:%d:spectators", i))
+	// Init the default lobby board (board 0), always present.
+	boardKey := fmt.Sprintf("board:%d", 0)
+	exists, _ := rdb.Exists(ctx, boardKey).Result()
+	if exists == 0 {
+		resetBoardState(0)
 	}
+	rdb.Del(ctx, fmt.Sprintf("board:%d:spectators", 0))
+	rdb.SAdd(ctx, "rooms:active", 0)
+	if ex, _ := rdb.Exists(ctx, metaKey(0)).Result(); ex == 0 {
+		rdb.HSet(ctx, metaKey(0), "name", "Lobby", "owner", "", "created_at", time.Now().UTC().Format(time.RFC3339), "visibility", "public")
+	}
+
+	startLobbyReaper()
+	startTurnScheduler()
 
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
@@ -254,6 +331,9 @@ func main() {
 			return
 		}
 		c := newClient(conn)
+		if !authenticate(c) {
+			return
+		}
 
 		go func() {
 			for {
@@ -274,32 +354,28 @@ func main() {
 
 func subscribeToBoard(c *client, boardID int) {
 	if c.pubsub != nil {
-		return
+		if c.boardID == boardID {
+			return
+		}
+		// Player moved rooms: tear down the old subscription before
+		// opening the new one.
+		c.pubsub.Close()
+		c.pubsub = nil
 	}
-	// sub
+
+	c.boardID = boardID
 	channel := fmt.Sprintf("board:%d", boardID)
-	pubsub := rdb.Subscribe(ctx, channel)
-	c.pubsub = pubsub
-
-	go func() {
-		defer pubsub.Close()
-		ch := pubsub.Channel()
-		for {
-			select {
-			case m, ok := <-ch:
-				if !ok {
-					return
-				}
-				c.safeSend([]byte(m.Payload))
-			case <-c.done:
-				return
-			}
-		}
-	}()
+	c.pubsub = rdb.subscribe(ctx, channel, func(payload string) {
+		c.safeSend([]byte(payload))
+	})
 }
 
 func broadcastSpectators(boardID int) {
 	key := fmt.Sprintf("board:%d:queue", boardID)
+	// Mostly called right after a queue mutation (RPush/LRem/LPop/Del); the
+	// RESP3 invalidation for LRangeCached arrives asynchronously, so a
+	// cached read here can race the mutation and publish a stale list.
+	// Read fresh instead and leave caching to the read-only get_board path.
 	specs, _ := rdb.LRange(ctx, key, 0, -1).Result()
 
 	msg := Message{
@@ -334,31 +410,46 @@ func rotatePlayers(boardID int) {
 	}
 
 	newX, err1 := rdb.LPop(ctx, queueKey).Result()
-	if err1 == redis.Nil {
+	if IsNil(err1) {
 		newX = "Waiting..."
 	}
 	newO, err2 := rdb.LPop(ctx, queueKey).Result()
-	if err2 == redis.Nil {
+	if IsNil(err2) {
 		newO = "Waiting..."
 	}
 
 	rdb.HSet(ctx, boardKey, "playerXName", newX, "playerOName", newO)
 	resetBoardState(boardID)
+	if newX != "Waiting..." && newO != "Waiting..." {
+		armTurnTimer(boardID)
+	}
 
 	data, _ := rdb.HGetAll(ctx, boardKey).Result()
-	bBoard, _ := json.Marshal(map[string]interface{}{"type": "board_state", "board": data})
+	bBoard, _ := json.Marshal(boardStateMessage(data))
 	rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), bBoard)
 	broadcastSpectators(boardID)
 }
 
 func handleClientMessage(c *client, sha string, msg Message) {
 	switch msg.Type {
+	case "create_room":
+		createRoom(c, msg)
+
+	case "list_rooms":
+		listRooms(c)
+
 	case "join":
-		boardID := 0
-		c.boardID = boardID
-		c.name = msg.Name
+		boardID := resolveBoardID(msg)
 		boardKey := fmt.Sprintf("board:%d", boardID)
 
+		meta, _ := rdb.HGetAll(ctx, metaKey(boardID)).Result()
+		if meta["visibility"] == "private" && msg.Password != meta["password"] {
+			sendJSON(c, map[string]string{"type": "error", "error": "wrong room password"})
+			return
+		}
+
+		c.name = msg.Name
+
 		currX, _ := rdb.HGet(ctx, boardKey, "playerXName").Result()
 		currO, _ := rdb.HGet(ctx, boardKey, "playerOName").Result()
 
@@ -372,7 +463,25 @@ func handleClientMessage(c *client, sha string, msg Message) {
 		}
 
 		if !assigned {
-			rdb.RPush(ctx, fmt.Sprintf("board:%d:queue", boardID), msg.Name)
+			queueKey := fmt.Sprintf("board:%d:queue", boardID)
+			maxSpectators := defaultMaxSpectators
+			if n, err := strconv.Atoi(meta["maxSpectators"]); err == nil && n > 0 {
+				maxSpectators = n
+			}
+			specLen, _ := rdb.LLen(ctx, queueKey).Result()
+			if int(specLen) >= maxSpectators {
+				sendJSON(c, map[string]string{"type": "error", "error": "room's spectator queue is full"})
+				return
+			}
+			rdb.RPush(ctx, queueKey, msg.Name)
+		} else {
+			_, to := transition(boardID, "player_joined")
+			if to == "in_progress" {
+				// First game on this board: rotatePlayers never runs and
+				// the move Lua script hasn't fired yet, so nothing else
+				// arms the opening turn deadline.
+				armTurnTimer(boardID)
+			}
 		}
 
 		sendJSON(c, map[string]interface{}{
@@ -383,15 +492,15 @@ func handleClientMessage(c *client, sha string, msg Message) {
 		subscribeToBoard(c, boardID)
 
 		data, _ := rdb.HGetAll(ctx, boardKey).Result()
-		b, _ := json.Marshal(map[string]interface{}{"type": "board_state", "board": data})
+		b, _ := json.Marshal(boardStateMessage(data))
 		rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), b)
 		broadcastSpectators(boardID)
 
 	case "get_board":
 		board := fmt.Sprintf("board:%d", msg.BoardID)
-		data, _ := rdb.HGetAll(ctx, board).Result()
-		sendJSON(c, map[string]interface{}{"type": "board_state", "board": data})
-		specs, _ := rdb.LRange(ctx, fmt.Sprintf("board:%d:queue", msg.BoardID), 0, -1).Result()
+		data, _ := rdb.HGetAllCached(ctx, board).Result()
+		sendJSON(c, boardStateMessage(data))
+		specs, _ := rdb.LRangeCached(ctx, fmt.Sprintf("board:%d:queue", msg.BoardID), 0, -1).Result()
 		sendJSON(c, map[string]interface{}{"type": "spectators_update", "spectators": specs})
 
 		//
@@ -428,7 +537,7 @@ func handleClientMessage(c *client, sha string, msg Message) {
 		board := fmt.Sprintf("board:%d", msg.BoardID)
 		pos := msg.Position
 
-		res, err := rdb.EvalSha(ctx, sha, []string{board}, pos, msg.Symbol).Result()
+		res, err := rdb.EvalSha(ctx, sha, []string{board}, pos, msg.Symbol, int(turnTimeout.Seconds())).Result()
 		if err != nil {
 			return
 		}
@@ -454,30 +563,58 @@ func handleClientMessage(c *client, sha string, msg Message) {
 		if len(arr) > 3 {
 			nextTurn, _ = arr[3].(string)
 		}
+		deadline := ""
+		if len(arr) > 4 {
+			deadline, _ = arr[4].(string)
+		}
 
 		update := map[string]interface{}{
-			"type":     "move_made",
-			"position": pos,
-			"symbol":   msg.Symbol,
-			"cells":    newCells,
-			"turn":     nextTurn,
-			"winner":   winner,
+			"type":         "move_made",
+			"position":     pos,
+			"symbol":       msg.Symbol,
+			"cells":        newCells,
+			"turn":         nextTurn,
+			"winner":       winner,
+			"turnDeadline": deadline,
 		}
 		b, _ := json.Marshal(update)
 		rdb.Publish(ctx, fmt.Sprintf("board:%d", msg.BoardID), b)
 
 		if winner != "" {
-			go func() {
-				time.Sleep(3 * time.Second)
-				rotatePlayers(msg.BoardID)
-			}()
+			event := "game_won"
+			if winner == "draw" {
+				event = "game_drawn"
+			}
+			transition(msg.BoardID, event)
+			transition(msg.BoardID, "game_over_ack")
+			scheduleTimer(msg.BoardID, "rotation_complete", 3*time.Second)
+		} else {
+			transition(msg.BoardID, "move_made")
+		}
+
+	case "resign":
+		resign(c, msg.BoardID)
+
+	case "kick":
+		if !hasPermission(c, "moderator") {
+			sendJSON(c, map[string]string{"type": "error", "error": "forbidden"})
+			return
 		}
+		kickPlayer(c, msg.BoardID, msg.Name)
+
+	case "reset_board":
+		if !hasPermission(c, "moderator") {
+			sendJSON(c, map[string]string{"type": "error", "error": "forbidden"})
+			return
+		}
+		resetRoom(msg.BoardID)
 
 	case "chat":
 		chatKey := fmt.Sprintf("board:%d:chat", msg.BoardID)
 
 		chatPayload := map[string]string{
 			"type":    "chat",
+			"id":      newMessageID(),
 			"name":    msg.Name,
 			"content": msg.Content,
 		}
@@ -494,6 +631,19 @@ func handleClientMessage(c *client, sha string, msg Message) {
 
 		// BROADCAST
 		rdb.Publish(ctx, fmt.Sprintf("board:%d", msg.BoardID), jsonBytes)
+
+	case "react":
+		react(c, msg.BoardID, msg.MessageID, msg.Emoji)
+
+	case "unreact":
+		unreact(c, msg.BoardID, msg.MessageID, msg.Emoji)
+
+	case "delete_message":
+		if !hasPermission(c, "moderator") {
+			sendJSON(c, map[string]string{"type": "error", "error": "forbidden"})
+			return
+		}
+		deleteMessage(msg.BoardID, msg.MessageID)
 	}
 }
 
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// transitionScript atomically reads a board's current state plus its seats
+// and computes the next state for an event, so concurrent moves and
+// disconnects cannot race each other's writes.
+var transitionScript = `
+local board = KEYS[1]
+local event = ARGV[1]
+
+local state = redis.call('HGET', board, 'state')
+if state == false or state == '' then
+  state = 'waiting_for_players'
+end
+local playerX = redis.call('HGET', board, 'playerXName') or ''
+local playerO = redis.call('HGET', board, 'playerOName') or ''
+local bothPresent = playerX ~= '' and playerX ~= 'Waiting...' and playerO ~= '' and playerO ~= 'Waiting...'
+
+local nextState = state
+
+if state == 'waiting_for_players' and event == 'player_joined' then
+  if bothPresent then nextState = 'in_progress' end
+elseif state == 'in_progress' and (event == 'game_won' or event == 'game_drawn' or event == 'timeout' or event == 'player_left') then
+  nextState = 'finished'
+elseif state == 'finished' and event == 'game_over_ack' then
+  nextState = 'rotating'
+elseif state == 'rotating' and event == 'rotation_complete' then
+  if bothPresent then nextState = 'in_progress' else nextState = 'waiting_for_players' end
+end
+
+redis.call('HSET', board, 'state', nextState)
+return { state, nextState }
+`
+
+var transitionSha string
+
+// transition atomically advances board<id>'s state machine for event and,
+// if the state actually changed, publishes a state_change frame so clients
+// can drive UI off it (e.g. a "Next round in Ns" countdown during rotating).
+func transition(boardID int, event string) (from, to string) {
+	res, err := rdb.EvalSha(ctx, transitionSha, []string{fmt.Sprintf("board:%d", boardID)}, event).Result()
+	if err != nil {
+		return "", ""
+	}
+	arr, ok := res.([]interface{})
+	if !ok || len(arr) < 2 {
+		return "", ""
+	}
+	from, _ = arr[0].(string)
+	to, _ = arr[1].(string)
+	if from != to {
+		publishStateChange(boardID, from, to, event)
+	}
+	return from, to
+}
+
+func publishStateChange(boardID int, from, to, reason string) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":   "state_change",
+		"from":   from,
+		"to":     to,
+		"reason": reason,
+	})
+	rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), b)
+}
+
+// scheduleTimer arms a delayed event in board:<id>:timers, a sorted set
+// scored by fire-at millis, instead of a blocking goroutine + time.Sleep —
+// so restarting the server does not lose a pending rotation.
+func scheduleTimer(boardID int, event string, delay time.Duration) {
+	fireAt := float64(time.Now().Add(delay).UnixMilli())
+	rdb.ZAdd(ctx, fmt.Sprintf("board:%d:timers", boardID), fireAt, event)
+}
+
+// scanDelayedTimers runs on the same scheduler tick as the turn-deadline
+// scan, firing any delayed event whose time has come.
+func scanDelayedTimers() {
+	ids, err := rdb.SMembers(ctx, "rooms:active").Result()
+	if err != nil {
+		return
+	}
+
+	nowMillis := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for _, idStr := range ids {
+		boardID, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		timersKey := fmt.Sprintf("board:%d:timers", boardID)
+		due, err := rdb.ZRangeByScore(ctx, timersKey, "-inf", nowMillis).Result()
+		if err != nil {
+			continue
+		}
+		for _, event := range due {
+			// ZREM is atomic, so when several servers race the same due
+			// entry only one of them actually removes it (n==1); the rest
+			// see n==0 and skip firing it a second time.
+			n, err := rdb.ZRem(ctx, timersKey, event).Result()
+			if err != nil || n == 0 {
+				continue
+			}
+			fireDelayedEvent(boardID, event)
+		}
+	}
+}
+
+func fireDelayedEvent(boardID int, event string) {
+	switch event {
+	case "rotation_complete":
+		rotatePlayers(boardID)
+		transition(boardID, "rotation_complete")
+	default:
+		log.Printf("unknown delayed event %q for board %d", event, boardID)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// cacheTTL is the client-side cache TTL used for hot read paths (get_board,
+// spectator lists). Overridden by the --cache-ttl flag.
+var cacheTTL = 5 * time.Second
+
+// store wraps the rueidis client so the rest of the server talks to Redis
+// through a small, go-redis-shaped surface instead of rueidis's command
+// builder directly. This is what contains the migration to one file.
+type store struct {
+	cl rueidis.Client
+}
+
+func newStore(addr string) (*store, error) {
+	cl, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{addr}})
+	if err != nil {
+		return nil, err
+	}
+	return &store{cl: cl}, nil
+}
+
+func (s *store) Close() { s.cl.Close() }
+
+// IsNil reports whether err represents a missing key/value (redis nil reply).
+func IsNil(err error) bool { return rueidis.IsRedisNil(err) }
+
+func (s *store) Ping(ctx context.Context) errResult {
+	return errResult{s.cl.Do(ctx, s.cl.B().Ping().Build()).Error()}
+}
+
+type errResult struct{ err error }
+
+func (r errResult) Err() error { return r.err }
+
+type strResult struct {
+	val string
+	err error
+}
+
+func (r strResult) Result() (string, error) { return r.val, r.err }
+
+type strMapResult struct {
+	val map[string]string
+	err error
+}
+
+func (r strMapResult) Result() (map[string]string, error) { return r.val, r.err }
+
+type strSliceResult struct {
+	val []string
+	err error
+}
+
+func (r strSliceResult) Result() ([]string, error) { return r.val, r.err }
+
+type intResult struct {
+	val int64
+	err error
+}
+
+func (r intResult) Result() (int64, error) { return r.val, r.err }
+
+type anyResult struct {
+	val interface{}
+	err error
+}
+
+func (r anyResult) Result() (interface{}, error) { return r.val, r.err }
+
+func toStrings(vals []interface{}) []string {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		out[i] = fmt.Sprint(v)
+	}
+	return out
+}
+
+func (s *store) HGetAll(ctx context.Context, key string) strMapResult {
+	m, err := s.cl.Do(ctx, s.cl.B().Hgetall().Key(key).Build()).AsStrMap()
+	return strMapResult{m, err}
+}
+
+// HGetAllCached is like HGetAll but leans on rueidis's RESP3 client-side
+// tracking: repeat reads of a hot board are served from the local copy
+// until the Lua move script or rotatePlayers mutates the hash and Redis
+// pushes an invalidation.
+func (s *store) HGetAllCached(ctx context.Context, key string) strMapResult {
+	m, err := s.cl.DoCache(ctx, s.cl.B().Hgetall().Key(key).Cache(), cacheTTL).AsStrMap()
+	return strMapResult{m, err}
+}
+
+func (s *store) HGet(ctx context.Context, key, field string) strResult {
+	v, err := s.cl.Do(ctx, s.cl.B().Hget().Key(key).Field(field).Build()).ToString()
+	return strResult{v, err}
+}
+
+func (s *store) HSet(ctx context.Context, key string, kv ...interface{}) intResult {
+	strs := toStrings(kv)
+	b := s.cl.B().Hset().Key(key).FieldValue()
+	for i := 0; i+1 < len(strs); i += 2 {
+		b = b.FieldValue(strs[i], strs[i+1])
+	}
+	n, err := s.cl.Do(ctx, b.Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) HDel(ctx context.Context, key string, fields ...string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Hdel().Key(key).Field(fields...).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) HIncrBy(ctx context.Context, key, field string, incr int64) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Hincrby().Key(key).Field(field).Increment(incr).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) Del(ctx context.Context, keys ...string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Del().Key(keys...).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) Exists(ctx context.Context, key string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Exists().Key(key).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) Expire(ctx context.Context, key string, ttl time.Duration) errResult {
+	return errResult{s.cl.Do(ctx, s.cl.B().Expire().Key(key).Seconds(int64(ttl.Seconds())).Build()).Error()}
+}
+
+func (s *store) Incr(ctx context.Context, key string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Incr().Key(key).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) SAdd(ctx context.Context, key string, members ...interface{}) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Sadd().Key(key).Member(toStrings(members)...).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) SRem(ctx context.Context, key string, members ...interface{}) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Srem().Key(key).Member(toStrings(members)...).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) SMembers(ctx context.Context, key string) strSliceResult {
+	v, err := s.cl.Do(ctx, s.cl.B().Smembers().Key(key).Build()).AsStrSlice()
+	return strSliceResult{v, err}
+}
+
+func (s *store) RPush(ctx context.Context, key string, values ...interface{}) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Rpush().Key(key).Element(toStrings(values)...).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) LPop(ctx context.Context, key string) strResult {
+	v, err := s.cl.Do(ctx, s.cl.B().Lpop().Key(key).Build()).ToString()
+	return strResult{v, err}
+}
+
+func (s *store) LRem(ctx context.Context, key string, count int64, value interface{}) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Lrem().Key(key).Count(count).Element(fmt.Sprint(value)).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) LRange(ctx context.Context, key string, start, stop int64) strSliceResult {
+	v, err := s.cl.Do(ctx, s.cl.B().Lrange().Key(key).Start(start).Stop(stop).Build()).AsStrSlice()
+	return strSliceResult{v, err}
+}
+
+// LRangeCached is the client-side-cached equivalent of LRange, used for the
+// spectator queue read on get_board (broadcastSpectators reads uncached).
+func (s *store) LRangeCached(ctx context.Context, key string, start, stop int64) strSliceResult {
+	v, err := s.cl.DoCache(ctx, s.cl.B().Lrange().Key(key).Start(start).Stop(stop).Cache(), cacheTTL).AsStrSlice()
+	return strSliceResult{v, err}
+}
+
+func (s *store) LLen(ctx context.Context, key string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Llen().Key(key).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) LTrim(ctx context.Context, key string, start, stop int64) errResult {
+	return errResult{s.cl.Do(ctx, s.cl.B().Ltrim().Key(key).Start(start).Stop(stop).Build()).Error()}
+}
+
+func (s *store) ScriptLoad(ctx context.Context, script string) strResult {
+	v, err := s.cl.Do(ctx, s.cl.B().ScriptLoad().Script(script).Build()).ToString()
+	return strResult{v, err}
+}
+
+func (s *store) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) anyResult {
+	cmd := s.cl.B().Evalsha().Sha1(sha).Numkeys(int64(len(keys))).Key(keys...).Arg(toStrings(args)...).Build()
+	v, err := s.cl.Do(ctx, cmd).ToAny()
+	return anyResult{v, err}
+}
+
+func (s *store) ZAdd(ctx context.Context, key string, score float64, member string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Zadd().Key(key).ScoreMember().ScoreMember(score, member).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) ZRangeByScore(ctx context.Context, key string, min, max string) strSliceResult {
+	v, err := s.cl.Do(ctx, s.cl.B().Zrangebyscore().Key(key).Min(min).Max(max).Build()).AsStrSlice()
+	return strSliceResult{v, err}
+}
+
+func (s *store) ZRem(ctx context.Context, key, member string) intResult {
+	n, err := s.cl.Do(ctx, s.cl.B().Zrem().Key(key).Member(member).Build()).AsInt64()
+	return intResult{n, err}
+}
+
+func (s *store) Publish(ctx context.Context, channel string, payload []byte) errResult {
+	return errResult{s.cl.Do(ctx, s.cl.B().Publish().Channel(channel).Message(string(payload)).Build()).Error()}
+}
+
+// HGetAllMulti batches HGETALL for every key in a single round trip, used
+// by the turn-deadline scheduler to scan every active board at once.
+func (s *store) HGetAllMulti(ctx context.Context, keys []string) []strMapResult {
+	cmds := make(rueidis.Commands, len(keys))
+	for i, k := range keys {
+		cmds[i] = s.cl.B().Hgetall().Key(k).Build()
+	}
+	resps := s.cl.DoMulti(ctx, cmds...)
+	out := make([]strMapResult, len(resps))
+	for i, r := range resps {
+		m, err := r.AsStrMap()
+		out[i] = strMapResult{m, err}
+	}
+	return out
+}
+
+// pubsubConn is a dedicated rueidis pubsub subscription that transparently
+// re-establishes itself if the connection drops.
+type pubsubConn struct {
+	stop chan struct{}
+	once chan struct{}
+}
+
+// subscribe opens a dedicated pubsub connection to channel and invokes
+// onMessage for every payload received, reconnecting on drop instead of
+// silently ending.
+func (s *store) subscribe(ctx context.Context, channel string, onMessage func(payload string)) *pubsubConn {
+	p := &pubsubConn{stop: make(chan struct{}), once: make(chan struct{})}
+
+	go func() {
+		for {
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+
+			dc, cancel := s.cl.Dedicate()
+			done := dc.SetPubSubHooks(rueidis.PubSubHooks{
+				OnMessage: func(m rueidis.PubSubMessage) {
+					onMessage(m.Message)
+				},
+			})
+
+			if err := dc.Do(ctx, dc.B().Subscribe().Channel(channel).Build()).Error(); err != nil {
+				cancel()
+				time.Sleep(time.Second)
+				continue
+			}
+
+			select {
+			case <-p.stop:
+				cancel()
+				return
+			case <-done:
+				// connection dropped; loop around and resubscribe
+				cancel()
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *pubsubConn) Close() {
+	select {
+	case <-p.once:
+		return
+	default:
+		close(p.once)
+		close(p.stop)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var turnTimeout = loadTurnTimeout()
+
+// loadTurnTimeout reads TURN_TIMEOUT_SECONDS, defaulting to 30s so local
+// dev keeps working without the env var set.
+func loadTurnTimeout() time.Duration {
+	secs := 30
+	if v := os.Getenv("TURN_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			secs = n
+		}
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// armTurnTimer sets the deadline for whoever is on the clock right now.
+// Successful moves arm it atomically inside the Lua script instead.
+func armTurnTimer(boardID int) {
+	deadline := time.Now().Add(turnTimeout).Unix()
+	rdb.HSet(ctx, fmt.Sprintf("board:%d", boardID), "turn_deadline", deadline)
+}
+
+func turnRemaining(data map[string]string) int {
+	deadlineStr := data["turn_deadline"]
+	if deadlineStr == "" {
+		return 0
+	}
+	deadline, err := strconv.ParseInt(deadlineStr, 10, 64)
+	if err != nil {
+		return 0
+	}
+	remaining := deadline - time.Now().Unix()
+	if remaining < 0 {
+		remaining = 0
+	}
+	return int(remaining)
+}
+
+func boardStateMessage(data map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":          "board_state",
+		"board":         data,
+		"turnRemaining": turnRemaining(data),
+	}
+}
+
+// startTurnScheduler ticks once a second, forfeiting any board whose
+// turn_deadline has passed.
+func startTurnScheduler() {
+	ticker := time.NewTicker(time.Second)
+	go func() {
+		for range ticker.C {
+			scanTurnDeadlines()
+			scanDelayedTimers()
+		}
+	}()
+}
+
+func scanTurnDeadlines() {
+	ids, err := rdb.SMembers(ctx, "rooms:active").Result()
+	if err != nil {
+		return
+	}
+
+	boardIDs := make([]int, 0, len(ids))
+	keys := make([]string, 0, len(ids))
+	for _, idStr := range ids {
+		boardID, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		boardIDs = append(boardIDs, boardID)
+		keys = append(keys, fmt.Sprintf("board:%d", boardID))
+	}
+
+	now := time.Now().Unix()
+	for i, res := range rdb.HGetAllMulti(ctx, keys) {
+		data, err := res.Result()
+		if err != nil || data["winner"] != "" {
+			continue
+		}
+		deadlineStr := data["turn_deadline"]
+		if deadlineStr == "" {
+			continue
+		}
+		deadline, err := strconv.ParseInt(deadlineStr, 10, 64)
+		if err != nil || now < deadline {
+			continue
+		}
+
+		// HDel is atomic, so when several servers race this same expired
+		// deadline only one of them removes the field and gets n==1; the
+		// rest see n==0 and back off instead of double-forfeiting.
+		boardKey := fmt.Sprintf("board:%d", boardIDs[i])
+		if n, _ := rdb.HDel(ctx, boardKey, "turn_deadline").Result(); n == 0 {
+			continue
+		}
+		forfeitTurn(boardIDs[i], data["turn"])
+	}
+}
+
+func forfeitTurn(boardID int, turn string) {
+	boardKey := fmt.Sprintf("board:%d", boardID)
+	winnerSym := "O"
+	if turn == "O" {
+		winnerSym = "X"
+	}
+
+	rdb.HSet(ctx, boardKey, "winner", winnerSym)
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":   "turn_timeout",
+		"winner": winnerSym,
+	})
+	rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), b)
+
+	transition(boardID, "timeout")
+	transition(boardID, "game_over_ack")
+	scheduleTimer(boardID, "rotation_complete", 3*time.Second)
+}
+
+// resign lets a player forfeit on demand, skipping the turn timer and
+// rotating immediately instead of waiting out the usual post-game delay.
+// Only the two seated players can trigger it; spectators and anyone else
+// are ignored rather than allowed to force a forfeit.
+func resign(c *client, boardID int) {
+	boardKey := fmt.Sprintf("board:%d", boardID)
+	data, _ := rdb.HGetAll(ctx, boardKey).Result()
+
+	if c.name == "" || (c.name != data["playerXName"] && c.name != data["playerOName"]) {
+		return
+	}
+
+	winnerSym := "O"
+	if c.name == data["playerOName"] {
+		winnerSym = "X"
+	}
+
+	rdb.HSet(ctx, boardKey, "winner", winnerSym)
+	rdb.HDel(ctx, boardKey, "turn_deadline")
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":   "resigned",
+		"name":   c.name,
+		"winner": winnerSym,
+	})
+	rdb.Publish(ctx, fmt.Sprintf("board:%d", boardID), b)
+
+	// Resigning skips the timer and rotates immediately instead of
+	// waiting out the usual post-game delay.
+	transition(boardID, "player_left")
+	transition(boardID, "game_over_ack")
+	rotatePlayers(boardID)
+	transition(boardID, "rotation_complete")
+}
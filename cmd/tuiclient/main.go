@@ -0,0 +1,425 @@
+// Command tuiclient is a terminal client for the tictactoe-redis WebSocket
+// protocol. It exists so contributors can exercise joins, moves, and chat
+// from a script or CI job without the browser frontend.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbletea"
+	"github.com/gorilla/websocket"
+)
+
+// Message mirrors the backend's wire format. It's duplicated here rather
+// than imported since the TUI client is its own module with no dependency
+// on the server binary.
+type Message struct {
+	Type          string            `json:"type"`
+	BoardID       int               `json:"boardId,omitempty"`
+	Position      int               `json:"position,omitempty"`
+	Symbol        string            `json:"symbol,omitempty"`
+	Name          string            `json:"name,omitempty"`
+	Spectators    []string          `json:"spectators,omitempty"`
+	Board         map[string]string `json:"board,omitempty"`
+	Content       string            `json:"content,omitempty"`
+	RoomCode      string            `json:"roomCode,omitempty"`
+	Token         string            `json:"token,omitempty"`
+	Expiry        int64             `json:"expiry,omitempty"`
+	Role          string            `json:"role,omitempty"`
+	MessageID     string            `json:"messageId,omitempty"`
+	Emoji         string            `json:"emoji,omitempty"`
+	Nonce         string            `json:"nonce,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	TurnRemaining int               `json:"turnRemaining,omitempty"`
+	Cells         string            `json:"cells,omitempty"`
+	Turn          string            `json:"turn,omitempty"`
+	Winner        string            `json:"winner,omitempty"`
+	From          string            `json:"from,omitempty"`
+	To            string            `json:"to,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	History       []string          `json:"history,omitempty"`
+}
+
+// chatRecord is the shape chat history entries are stored in, one JSON
+// object per line in chat_history.jsonl and per element of a chat_history
+// frame's history slice.
+type chatRecord struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "server address (host:port)")
+	name := flag.String("name", "guest", "player name")
+	room := flag.String("room", "", "room code to join (defaults to the lobby board)")
+	secret := flag.String("auth-secret", "", "AUTH_SECRET to self-sign a dev token (leave empty if the server runs with ALLOW_ANON_GUESTS)")
+	flag.Parse()
+
+	conn := newConnection(*addr, *name, *room, *secret)
+	defer conn.stop()
+
+	m := newModel(conn, *name)
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	conn.program = p
+
+	if _, err := p.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// connection owns the WebSocket and reconnects with exponential backoff,
+// forwarding every decoded frame into the bubbletea program as a tea.Msg.
+type connection struct {
+	addr, name, room, secret string
+	program                  *tea.Program
+	writer                   chan Message
+	quit                     chan struct{}
+}
+
+func newConnection(addr, name, room, secret string) *connection {
+	c := &connection{addr: addr, name: name, room: room, secret: secret, quit: make(chan struct{})}
+	go c.run()
+	return c
+}
+
+func (c *connection) stop() { close(c.quit) }
+
+func (c *connection) run() {
+	backoff := 500 * time.Millisecond
+	const maxBackoff = 30 * time.Second
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+
+		if err := c.connectOnce(); err != nil {
+			c.deliver(Message{Type: "client_error", Content: err.Error()})
+		}
+
+		select {
+		case <-c.quit:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (c *connection) connectOnce() error {
+	u := url.URL{Scheme: "ws", Host: c.addr, Path: "/ws"}
+	ws, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	if err := c.handshake(ws); err != nil {
+		return err
+	}
+
+	join := Message{Type: "join", Name: c.name}
+	if c.room != "" {
+		join.RoomCode = c.room
+	}
+	if err := ws.WriteJSON(join); err != nil {
+		return err
+	}
+
+	c.deliver(Message{Type: "client_connected"})
+
+	writeCh := make(chan Message, 16)
+	c.registerWriter(writeCh)
+	defer c.unregisterWriter()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg Message
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			c.deliver(msg)
+		}
+	}()
+
+	for {
+		select {
+		case <-c.quit:
+			return nil
+		case <-done:
+			return fmt.Errorf("connection lost")
+		case msg := <-writeCh:
+			if err := ws.WriteJSON(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// helloWait bounds how long handshake will wait for a server "hello"
+// before assuming the server runs with ALLOW_ANON_GUESTS and skips the
+// handshake entirely (it never sends a hello and just waits for "join").
+const helloWait = 500 * time.Millisecond
+
+// handshake replies to the server's hello nonce. If auth-secret was given
+// it signs a short-lived token; otherwise it sends an auth reply with an
+// empty token, which a server that sent a hello rejects. A
+// server in that mode never sends a hello at all, so a bare ReadJSON here
+// would deadlock both sides; a short read deadline lets us fall through
+// to the caller's "join" instead.
+func (c *connection) handshake(ws *websocket.Conn) error {
+	var hello Message
+	ws.SetReadDeadline(time.Now().Add(helloWait))
+	err := ws.ReadJSON(&hello)
+	ws.SetReadDeadline(time.Time{})
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			// No hello arrived; assume ALLOW_ANON_GUESTS and let the
+			// caller send "join" first.
+			return nil
+		}
+		return err
+	}
+	if hello.Type != "hello" {
+		// Server skipped the handshake (anonymous-guest mode); treat
+		// whatever it sent first as a regular protocol frame.
+		c.deliver(hello)
+		return nil
+	}
+
+	expiry := time.Now().Add(time.Minute).Unix()
+	role := "player"
+	var token string
+	if c.secret != "" {
+		mac := hmac.New(sha256.New, []byte(c.secret))
+		mac.Write([]byte(hello.Nonce + "|" + c.name + "|" + role + "|" + strconv.FormatInt(expiry, 10)))
+		token = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	return ws.WriteJSON(Message{Type: "auth", Name: c.name, Role: role, Expiry: expiry, Token: token})
+}
+
+// deliver hands a decoded frame to the bubbletea program as a tea.Msg.
+func (c *connection) deliver(msg Message) {
+	if c.program != nil {
+		c.program.Send(msg)
+	}
+}
+
+// registerWriter/unregisterWriter track the channel the active socket
+// connection is reading outbound messages from, so Send works across
+// reconnects without the UI model needing to know about them.
+func (c *connection) registerWriter(ch chan Message) { c.writer = ch }
+func (c *connection) unregisterWriter()              { c.writer = nil }
+
+// Send queues an outbound message for the active connection, if any.
+func (c *connection) Send(msg Message) {
+	if c.writer != nil {
+		select {
+		case c.writer <- msg:
+		default:
+		}
+	}
+}
+
+// --- bubbletea model ---
+
+type focusMode int
+
+const (
+	focusBoard focusMode = iota
+	focusChat
+)
+
+type model struct {
+	conn   *connection
+	name   string
+	status string
+
+	boardID    int
+	cells      [9]string
+	turn       string
+	winner     string
+	remaining  int
+	spectators []string
+	chat       []string
+
+	focus     focusMode
+	chatInput string
+}
+
+func newModel(conn *connection, name string) model {
+	m := model{conn: conn, name: name, status: "connecting..."}
+	for i := range m.cells {
+		m.cells[i] = "_"
+	}
+	return m
+}
+
+func (m model) Init() tea.Cmd { return nil }
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	case Message:
+		return m.handleFrame(msg), nil
+	}
+	return m, nil
+}
+
+func (m model) handleKey(k tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.focus == focusChat {
+		switch k.String() {
+		case "esc":
+			m.focus = focusBoard
+			m.chatInput = ""
+		case "enter":
+			content := strings.TrimSpace(m.chatInput)
+			m.chatInput = ""
+			m.focus = focusBoard
+			if content != "" {
+				m.conn.Send(Message{Type: "chat", BoardID: m.boardID, Name: m.name, Content: content})
+			}
+		case "backspace":
+			if len(m.chatInput) > 0 {
+				m.chatInput = m.chatInput[:len(m.chatInput)-1]
+			}
+		default:
+			m.chatInput += k.String()
+		}
+		return m, nil
+	}
+
+	switch k.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "/":
+		m.focus = focusChat
+	case "r":
+		m.conn.Send(Message{Type: "resign", BoardID: m.boardID})
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		pos, _ := strconv.Atoi(k.String())
+		symbol := "X"
+		if m.turn == "O" {
+			symbol = "O"
+		}
+		m.conn.Send(Message{Type: "move", BoardID: m.boardID, Position: pos, Symbol: symbol})
+	}
+	return m, nil
+}
+
+func (m model) handleFrame(msg Message) model {
+	switch msg.Type {
+	case "client_connected":
+		m.status = "connected"
+	case "client_error":
+		m.status = "reconnecting: " + msg.Content
+	case "joined":
+		m.boardID = msg.BoardID
+		m.status = fmt.Sprintf("joined board %d", msg.BoardID)
+	case "board_state":
+		m.applyBoard(msg.Board)
+		m.remaining = msg.TurnRemaining
+	case "move_made":
+		m.applyCells(msg.Cells)
+		m.turn = msg.Turn
+		m.winner = msg.Winner
+	case "spectators_update":
+		m.spectators = msg.Spectators
+	case "chat":
+		if msg.Content != "" {
+			m.chat = append(m.chat, fmt.Sprintf("%s: %s", msg.Name, msg.Content))
+		}
+	case "chat_history":
+		for _, raw := range msg.History {
+			var rec chatRecord
+			if err := json.Unmarshal([]byte(raw), &rec); err == nil && rec.Content != "" {
+				m.chat = append(m.chat, fmt.Sprintf("%s: %s", rec.Name, rec.Content))
+			}
+		}
+	case "turn_timeout":
+		m.status = "turn timed out, winner: " + msg.Winner
+	case "resigned":
+		m.status = fmt.Sprintf("%s resigned, winner: %s", msg.Name, msg.Winner)
+	case "state_change":
+		m.status = fmt.Sprintf("state: %s -> %s (%s)", msg.From, msg.To, msg.Reason)
+	case "error":
+		m.status = "error: " + msg.Error
+	}
+	if len(m.chat) > 200 {
+		m.chat = m.chat[len(m.chat)-200:]
+	}
+	return m
+}
+
+func (m *model) applyBoard(board map[string]string) {
+	if board == nil {
+		return
+	}
+	m.applyCells(board["cells"])
+	m.turn = board["turn"]
+	m.winner = board["winner"]
+}
+
+func (m *model) applyCells(cells string) {
+	if cells == "" {
+		return
+	}
+	parts := strings.Split(cells, ",")
+	for i := 0; i < 9 && i < len(parts); i++ {
+		m.cells[i] = parts[i]
+	}
+}
+
+func (m model) View() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "tictactoe-redis — %s — %s\n\n", m.name, m.status)
+
+	for row := 0; row < 3; row++ {
+		fmt.Fprintf(&b, " %s | %s | %s \n", m.cells[row*3], m.cells[row*3+1], m.cells[row*3+2])
+		if row < 2 {
+			b.WriteString("---+---+---\n")
+		}
+	}
+
+	fmt.Fprintf(&b, "\nturn: %s  winner: %s  remaining: %ds\n", m.turn, m.winner, m.remaining)
+
+	b.WriteString("\nspectators: ")
+	b.WriteString(strings.Join(m.spectators, ", "))
+	b.WriteString("\n\nchat:\n")
+	start := 0
+	if len(m.chat) > 10 {
+		start = len(m.chat) - 10
+	}
+	for _, line := range m.chat[start:] {
+		b.WriteString("  " + line + "\n")
+	}
+
+	if m.focus == focusChat {
+		fmt.Fprintf(&b, "\n> %s_\n", m.chatInput)
+	} else {
+		b.WriteString("\n[1-9] move  [r] resign  [/] chat  [q] quit\n")
+	}
+
+	return b.String()
+}